@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AuthModules holds the top-level `auth_modules:` section of the exporter
+// config, keyed by module name. It is parsed independently of the
+// sql_exporter library config so that probe credentials never need to
+// travel in the query string.
+type AuthModules map[string]*AuthModule
+
+// AuthModule supplies the pieces of a DSN that `/probe` merges into the
+// target DSN at request time. Exactly one of UserPass or KeyringFile
+// should be set. KeyringFile is parsed but not read: Resolve rejects any
+// module that sets it, so only UserPass credentials are ever merged.
+type AuthModule struct {
+	Type        string        `yaml:"type"`
+	UserPass    *UserPassAuth `yaml:"userpass,omitempty"`
+	KeyringFile string        `yaml:"keyring_file,omitempty"`
+	Params      url.Values    `yaml:"params,omitempty"`
+}
+
+// UserPassAuth is a plain username/password credential pair.
+type UserPassAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type authModulesFile struct {
+	AuthModules AuthModules `yaml:"auth_modules"`
+}
+
+// LoadAuthModules reads the `auth_modules:` section from the exporter config
+// file. A config file with no such section is not an error - it simply
+// yields an empty set, since auth modules are optional.
+func LoadAuthModules(configFile string) (AuthModules, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var f authModulesFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse auth_modules: %w", err)
+	}
+
+	return f.AuthModules, nil
+}
+
+// Resolve merges the named auth module's credentials into dsn, returning the
+// DSN the probe target should actually connect with. An empty name is a
+// no-op - the caller-supplied DSN is used as-is.
+//
+// Only two DSN shapes can be merged into safely: URI-style DSNs
+// (scheme://[user[:pass]@]host/...) and libpq/Postgres-style key=value DSNs
+// (host=... user=... dbname=...). Other shapes - notably the Go MySQL
+// driver's user:pass@tcp(host:port)/db - are rejected outright rather than
+// silently mangled or left connecting with whatever credentials were
+// already embedded in the DSN.
+func (m AuthModules) Resolve(name, dsn string) (string, error) {
+	if name == "" {
+		return dsn, nil
+	}
+
+	module, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("unknown auth_module %q", name)
+	}
+	if module.KeyringFile != "" {
+		return "", fmt.Errorf("auth_module %q: keyring_file auth is not yet supported", name)
+	}
+	if module.UserPass == nil {
+		return "", fmt.Errorf("auth_module %q: no credentials configured", name)
+	}
+
+	switch {
+	case strings.Contains(dsn, "://"):
+		resolved, err := resolveURIDSN(dsn, module)
+		if err != nil {
+			return "", fmt.Errorf("auth_module %q: %w", name, err)
+		}
+		return resolved, nil
+	case keyValueDSNPattern.MatchString(dsn):
+		resolved, err := resolveKeyValueDSN(dsn, module)
+		if err != nil {
+			return "", fmt.Errorf("auth_module %q: %w", name, err)
+		}
+		return resolved, nil
+	default:
+		return "", fmt.Errorf("auth_module %q: DSN format is not supported for credential injection (expected a URI or key=value DSN)", name)
+	}
+}
+
+// resolveURIDSN merges module's credentials into a URI-style DSN.
+func resolveURIDSN(dsn string, module *AuthModule) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("target is not a valid URI DSN: %w", err)
+	}
+
+	u.User = url.UserPassword(module.UserPass.Username, module.UserPass.Password)
+	if len(module.Params) > 0 {
+		q := u.Query()
+		for k, vs := range module.Params {
+			for _, v := range vs {
+				q.Set(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String(), nil
+}
+
+var keyValueDSNPattern = regexp.MustCompile(`^\s*[A-Za-z_][A-Za-z0-9_]*\s*=`)
+
+// resolveKeyValueDSN merges module's credentials into a libpq-style
+// "key=value ..." DSN, replacing any existing user/password keywords and
+// appending them if absent.
+func resolveKeyValueDSN(dsn string, module *AuthModule) (string, error) {
+	pairs, err := parseKeyValueDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	pairs = setKeyValueDSNPair(pairs, "user", module.UserPass.Username)
+	pairs = setKeyValueDSNPair(pairs, "password", module.UserPass.Password)
+	for k, vs := range module.Params {
+		if len(vs) > 0 {
+			pairs = setKeyValueDSNPair(pairs, k, vs[0])
+		}
+	}
+
+	var b strings.Builder
+	for i, p := range pairs {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.key)
+		b.WriteByte('=')
+		b.WriteString(quoteKeyValueDSNValue(p.value))
+	}
+	return b.String(), nil
+}
+
+type keyValueDSNPair struct {
+	key   string
+	value string
+}
+
+func setKeyValueDSNPair(pairs []keyValueDSNPair, key, value string) []keyValueDSNPair {
+	for i := range pairs {
+		if pairs[i].key == key {
+			pairs[i].value = value
+			return pairs
+		}
+	}
+	return append(pairs, keyValueDSNPair{key: key, value: value})
+}
+
+func quoteKeyValueDSNValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " '\\") {
+		v = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+		return "'" + v + "'"
+	}
+	return v
+}
+
+// parseKeyValueDSN parses a libpq-style "key=value ..." DSN, honoring single
+// quoted values with backslash escapes.
+func parseKeyValueDSN(dsn string) ([]keyValueDSNPair, error) {
+	var pairs []keyValueDSNPair
+	i, n := 0, len(dsn)
+	for i < n {
+		for i < n && dsn[i] == ' ' {
+			i++
+		}
+		if i >= n {
+			break
+		}
+
+		keyStart := i
+		for i < n && dsn[i] != '=' && dsn[i] != ' ' {
+			i++
+		}
+		if i >= n || dsn[i] != '=' {
+			return nil, fmt.Errorf("malformed key=value DSN near %q", dsn[keyStart:])
+		}
+		key := dsn[keyStart:i]
+		i++ // skip '='
+
+		var value strings.Builder
+		if i < n && dsn[i] == '\'' {
+			i++
+			for i < n && dsn[i] != '\'' {
+				if dsn[i] == '\\' && i+1 < n {
+					i++
+				}
+				value.WriteByte(dsn[i])
+				i++
+			}
+			if i >= n {
+				return nil, fmt.Errorf("unterminated quoted value for key %q", key)
+			}
+			i++ // skip closing quote
+		} else {
+			for i < n && dsn[i] != ' ' {
+				value.WriteByte(dsn[i])
+				i++
+			}
+		}
+
+		pairs = append(pairs, keyValueDSNPair{key: key, value: value.String()})
+	}
+	return pairs, nil
+}
+
+func splitAndTrim(s string) []string {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package main
+
+import "testing"
+
+func TestParseKeyValueDSNRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		dsn  string
+		want []keyValueDSNPair
+	}{
+		{
+			name: "plain values",
+			dsn:  "host=db.internal port=5432 dbname=metrics",
+			want: []keyValueDSNPair{
+				{key: "host", value: "db.internal"},
+				{key: "port", value: "5432"},
+				{key: "dbname", value: "metrics"},
+			},
+		},
+		{
+			name: "quoted value with space",
+			dsn:  "host=db.internal password='s3cret pass'",
+			want: []keyValueDSNPair{
+				{key: "host", value: "db.internal"},
+				{key: "password", value: "s3cret pass"},
+			},
+		},
+		{
+			name: "quoted value with escaped quote and backslash",
+			dsn:  `host=db.internal password='it\'s a \\secret'`,
+			want: []keyValueDSNPair{
+				{key: "host", value: "db.internal"},
+				{key: "password", value: `it's a \secret`},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseKeyValueDSN(tc.dsn)
+			if err != nil {
+				t.Fatalf("parseKeyValueDSN(%q): %v", tc.dsn, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("parseKeyValueDSN(%q) = %+v, want %+v", tc.dsn, got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("pair %d = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+
+			// Round-trip: reserialize with quoteKeyValueDSNValue and
+			// reparse - the result must decode back to the same pairs,
+			// regardless of whether the original needed quoting.
+			reserialized, err := resolveKeyValueDSNForTest(got)
+			if err != nil {
+				t.Fatalf("reserializing %+v: %v", got, err)
+			}
+			reparsed, err := parseKeyValueDSN(reserialized)
+			if err != nil {
+				t.Fatalf("parseKeyValueDSN(%q) (round-trip): %v", reserialized, err)
+			}
+			if len(reparsed) != len(tc.want) {
+				t.Fatalf("round-trip %+v, want %+v", reparsed, tc.want)
+			}
+			for i := range reparsed {
+				if reparsed[i] != tc.want[i] {
+					t.Errorf("round-trip pair %d = %+v, want %+v", i, reparsed[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+// resolveKeyValueDSNForTest reassembles pairs the same way resolveKeyValueDSN
+// does, without requiring an AuthModule.
+func resolveKeyValueDSNForTest(pairs []keyValueDSNPair) (string, error) {
+	dsn := ""
+	for i, p := range pairs {
+		if i > 0 {
+			dsn += " "
+		}
+		dsn += p.key + "=" + quoteKeyValueDSNValue(p.value)
+	}
+	return dsn, nil
+}
+
+func TestQuoteKeyValueDSNValue(t *testing.T) {
+	cases := []struct {
+		value string
+		want  string
+	}{
+		{value: "metrics", want: "metrics"},
+		{value: "", want: "''"},
+		{value: "has space", want: "'has space'"},
+		{value: `with'quote`, want: `'with\'quote'`},
+		{value: `with\backslash`, want: `'with\\backslash'`},
+	}
+
+	for _, tc := range cases {
+		if got := quoteKeyValueDSNValue(tc.value); got != tc.want {
+			t.Errorf("quoteKeyValueDSNValue(%q) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestResolveKeyValueDSNReplacesCredentials(t *testing.T) {
+	module := &AuthModule{UserPass: &UserPassAuth{Username: "probe", Password: "s3cret pass"}}
+
+	resolved, err := resolveKeyValueDSN("host=db.internal user=old password=old dbname=metrics", module)
+	if err != nil {
+		t.Fatalf("resolveKeyValueDSN: %v", err)
+	}
+
+	pairs, err := parseKeyValueDSN(resolved)
+	if err != nil {
+		t.Fatalf("parseKeyValueDSN(%q): %v", resolved, err)
+	}
+
+	got := map[string]string{}
+	for _, p := range pairs {
+		got[p.key] = p.value
+	}
+	if got["user"] != "probe" {
+		t.Errorf("user = %q, want %q", got["user"], "probe")
+	}
+	if got["password"] != "s3cret pass" {
+		t.Errorf("password = %q, want %q", got["password"], "s3cret pass")
+	}
+	if got["host"] != "db.internal" || got["dbname"] != "metrics" {
+		t.Errorf("unrelated pairs mutated: %+v", got)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// NewLogger builds the process-wide *slog.Logger from the --log.level and
+// --log.format flags, replacing the klog/promlog setup this exporter used
+// to carry.
+func NewLogger(level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log.level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case "logfmt", "":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return nil, fmt.Errorf("invalid log.format %q: must be json or logfmt", format)
+	}
+
+	return slog.New(handler), nil
+}
+
+// goKitLogger adapts an *slog.Logger to the go-kit style `Log(keyvals ...)
+// error` interface expected by prometheus/exporter-toolkit/web.
+type goKitLogger struct {
+	logger *slog.Logger
+}
+
+// Log implements the go-kit logger interface. go-kit callers (e.g.
+// level.Error(logger).Log(...) inside prometheus/exporter-toolkit/web)
+// embed the level as a "level" key/value pair rather than calling a
+// level-specific method, so it has to be pulled back out here - otherwise
+// every log line would go out at Info regardless of --log.level, and
+// operators filtering for errors would silently lose them.
+func (l goKitLogger) Log(keyvals ...interface{}) error {
+	level := slog.LevelInfo
+	args := make([]interface{}, 0, len(keyvals))
+
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if ok && key == "level" {
+			if lvl, ok := parseGoKitLevel(keyvals[i+1]); ok {
+				level = lvl
+				continue
+			}
+		}
+		args = append(args, keyvals[i], keyvals[i+1])
+	}
+	if len(keyvals)%2 == 1 {
+		args = append(args, keyvals[len(keyvals)-1])
+	}
+
+	l.logger.Log(context.Background(), level, "", args...)
+	return nil
+}
+
+// parseGoKitLevel recognizes go-kit/log/level's Value type by duck-typing
+// on fmt.Stringer, without adding a dependency on that package just for
+// this conversion.
+func parseGoKitLevel(v interface{}) (slog.Level, bool) {
+	s, ok := v.(fmt.Stringer)
+	if !ok {
+		return 0, false
+	}
+
+	switch s.String() {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	default:
+		return 0, false
+	}
+}
+
+// slogPromHTTPLogger adapts an *slog.Logger to promhttp.Logger, so the
+// exporter's metric/probe handlers log through the same logger as the rest
+// of the process.
+type slogPromHTTPLogger struct {
+	logger *slog.Logger
+}
+
+// Println implements promhttp.Logger.
+func (l slogPromHTTPLogger) Println(args ...interface{}) {
+	l.logger.Error(fmt.Sprint(args...))
+}
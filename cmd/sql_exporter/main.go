@@ -4,29 +4,28 @@ import (
 	"flag"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
-	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/burningalchemist/sql_exporter"
 	_ "github.com/kardianos/minwinsvc"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
-	"k8s.io/klog/v2"
 )
 
 const (
 	envConfigFile         string        = "SQLEXPORTER_CONFIG"
 	envDebug              string        = "SQLEXPORTER_DEBUG"
 	httpReadHeaderTimeout time.Duration = time.Duration(time.Second * 60)
-	debugMaxLevel         klog.Level    = 3
 )
 
 var (
@@ -36,8 +35,8 @@ var (
 	enableReload  = flag.Bool("web.enable-reload", false, "Enable reload collector data handler")
 	webConfigFile = flag.String("web.config.file", "", "[EXPERIMENTAL] TLS/BasicAuth configuration file path")
 	configFile    = flag.String("config.file", "/config/sql_exporter.yml", "SQL Exporter configuration file path")
-	logFormatJSON = flag.Bool("log.json", false, "Set log output format to JSON")
-	logLevel      = flag.String("log.level", "info", "Set log level")
+	logFormat     = flag.String("log.format", "logfmt", "Set log output format, one of: [logfmt, json]")
+	logLevel      = flag.String("log.level", "info", "Set log level, one of: [debug, info, warn, error]")
 )
 
 func init() {
@@ -52,25 +51,12 @@ func main() {
 
 	flag.Parse()
 
-	promlogConfig := &promlog.Config{}
-	promlogConfig.Level = &promlog.AllowedLevel{}
-	_ = promlogConfig.Level.Set(*logLevel)
-	if *logFormatJSON {
-		promlogConfig.Format = &promlog.AllowedFormat{}
-		_ = promlogConfig.Format.Set("json")
+	logger, err := NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		log.Fatal(err)
 	}
+	slog.SetDefault(logger)
 
-	// Overriding the default klog with our go-kit klog implementation.
-	// Thus we need to pass it our go-kit logger object.
-	logger := promlog.New(promlogConfig)
-	klog.SetLogger(logger)
-	klog.ClampLevel(debugMaxLevel)
-
-	// Override --alsologtostderr default value.
-	if alsoLogToStderr := flag.Lookup("alsologtostderr"); alsoLogToStderr != nil {
-		alsoLogToStderr.DefValue = "true"
-		_ = alsoLogToStderr.Value.Set("true")
-	}
 	// Override the config.file default with the SQLEXPORTER_CONFIG environment variable if set.
 	if val, ok := os.LookupEnv(envConfigFile); ok {
 		*configFile = val
@@ -81,92 +67,87 @@ func main() {
 		os.Exit(0)
 	}
 
-	klog.Warningf("Starting SQL exporter %s %s", version.Info(), version.BuildContext())
+	logger.Warn(fmt.Sprintf("Starting SQL exporter %s %s", version.Info(), version.BuildContext()))
 
 	exporter, err := sql_exporter.NewExporter(*configFile)
 	if err != nil {
-		klog.Errorf("Error reloading config: %s", err)
+		logger.Error("Error reloading config", "err", err)
 	}
 
-	// Expose refresh handler to reload query collections
+	authModules, err := LoadAuthModules(*configFile)
+	if err != nil {
+		logger.Error("Error loading auth modules", "err", err)
+	}
+
+	reloader := newReloader(*configFile, exporter, authModules, logger)
+
+	// Reload the config and collectors on SIGHUP, matching the convention
+	// used by Prometheus and its exporters.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logger.Warn("Reloading config due to SIGHUP")
+			if err := reloader.Reload(); err != nil {
+				logger.Error("Error reloading config", "err", err)
+			}
+		}
+	}()
+
+	// Also reload on config file changes, instead of restarting the process.
 	if *enableReload {
-		// Create new watcher.
 		watcher, err := fsnotify.NewWatcher()
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer watcher.Close()
 
-		// start check content
-		go func() {
-			config, err := ioutil.ReadFile(*configFile)
-			if err != nil {
-				klog.Fatalf("RFailed to read config file: %v", err.Error())
-			}
-
-			ticker := time.NewTicker(1 * time.Second)
-			for range ticker.C {
-				newConfig, err := ioutil.ReadFile(*configFile)
-				if err != nil {
-					klog.Fatalf("RFailed to read config file: %v", err.Error())
-					continue
-				}
-
-				if string(config) != string(newConfig) {
-					klog.Warning("Restart application due to modified config file")
-					os.Exit(1)
-				}
-			}
-		}()
-
-		// Start listening for events.
 		go func() {
 			for {
-				// fsnotify event
 				select {
 				case event, ok := <-watcher.Events:
 					if !ok {
 						return
 					}
 					if event.Has(fsnotify.Write) {
-						klog.Warningf("Restart application due to modified config file: %v", event.Name)
-						os.Exit(1)
+						logger.Warn("Reloading config due to modified config file", "file", event.Name)
+						if err := reloader.Reload(); err != nil {
+							logger.Error("Error reloading config", "err", err)
+						}
 					}
 				case err, ok := <-watcher.Errors:
 					if !ok {
 						return
 					}
-					log.Println("error:", err)
+					logger.Error("fsnotify error", "err", err)
 				}
 			}
 		}()
 
-		// Add a path.
-		err = watcher.Add(filepath.Dir(*configFile))
-		if err != nil {
+		if err := watcher.Add(filepath.Dir(*configFile)); err != nil {
 			log.Fatal(err)
 		}
-
-		// Don't block the main goroutine.
-		go func() {
-			// Wait for termination signal.
-			<-make(chan struct{})
-		}()
 	}
 
 	// Setup and start webserver.
 	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { http.Error(w, "OK", http.StatusOK) })
 	http.HandleFunc("/", HomeHandlerFunc(*metricsPath))
-	http.HandleFunc("/config", ConfigHandlerFunc(*metricsPath, exporter))
-	http.Handle(*metricsPath, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, ExporterHandlerFor(exporter)))
+	http.HandleFunc("/config", ConfigHandlerFunc(*metricsPath, reloader))
+	http.Handle(*metricsPath, instrumentHandler("metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, ExporterHandlerFor(instrumentedExporter{reloader}))))
+	// Expose a multi-target probe endpoint so one exporter instance can scrape
+	// arbitrary DSNs, e.g. SaaS databases a sidecar can't be deployed next to.
+	// Prometheus is expected to fan out over targets via relabel_configs.
+	http.Handle("/probe", instrumentHandler("probe", ProbeHandlerFor(reloader, logger)))
+	http.HandleFunc("/-/reload", ReloadHandlerFor(reloader))
 	// Expose exporter metrics separately, for debugging purposes.
-	http.Handle("/sql_exporter_metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{}))
+	http.Handle("/sql_exporter_metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{ErrorLog: slogPromHTTPLogger{logger: logger}}))
 
-	klog.Warning("Listening on ", *listenAddress)
+	logger.Warn("Listening on " + *listenAddress)
 
 	server := &http.Server{Addr: *listenAddress, ReadHeaderTimeout: httpReadHeaderTimeout}
-	if err := web.ListenAndServe(server, &web.FlagConfig{WebListenAddresses: &([]string{*listenAddress}), WebConfigFile: webConfigFile, WebSystemdSocket: OfBool(false)}, logger); err != nil {
-		klog.Fatal(err)
+	if err := web.ListenAndServe(server, &web.FlagConfig{WebListenAddresses: &([]string{*listenAddress}), WebConfigFile: webConfigFile, WebSystemdSocket: OfBool(false)}, goKitLogger{logger}); err != nil {
+		logger.Error("Error starting server", "err", err)
+		os.Exit(1)
 	}
 }
 
@@ -174,33 +155,3 @@ func main() {
 func OfBool(i bool) *bool {
 	return &i
 }
-
-func reloadCollectors(e sql_exporter.Exporter) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		klog.Infof("Reloading the collectors...")
-		config := e.Config()
-		if err := config.ReloadCollectorFiles(); err != nil {
-			klog.Errorf("Error reloading collector configs - %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
-
-		// FIXME: Should be t.Collectors() instead of config.Collectors
-		target, err := sql_exporter.NewTarget("", "", string(config.Target.DSN), config.Collectors, nil, config.Globals)
-		if err != nil {
-			klog.Errorf("Error creating a new target - %v", err)
-		}
-		e.UpdateTarget([]sql_exporter.Target{target})
-
-		klog.Infof("Query collectors have been successfully reloaded")
-		w.WriteHeader(http.StatusNoContent)
-	}
-}
-
-// LogFunc is an adapter to allow the use of any function as a promhttp.Logger. If f is a function, LogFunc(f) is a
-// promhttp.Logger that calls f.
-type LogFunc func(args ...interface{})
-
-// Println implements promhttp.Logger.
-func (log LogFunc) Println(args ...interface{}) {
-	log(args)
-}
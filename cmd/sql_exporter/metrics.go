@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/burningalchemist/sql_exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Self-observability metrics for the exporter process itself, as distinct
+// from the metrics its collectors scrape out of target databases. Registered
+// on the default registry alongside version.NewCollector.
+var (
+	scrapeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "sql_exporter_scrape_duration_seconds",
+		Help: "Duration of a target scrape, by target and collector.",
+	}, []string{"target", "collector"})
+
+	scrapeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sql_exporter_scrape_errors_total",
+		Help: "Total number of errors scraping a target, by target and collector.",
+	}, []string{"target", "collector"})
+
+	targetUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sql_exporter_target_up",
+		Help: "Whether the last scrape of a target succeeded.",
+	}, []string{"target"})
+
+	lastScrapeTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sql_exporter_last_scrape_timestamp_seconds",
+		Help: "Timestamp of the last scrape of a target.",
+	}, []string{"target"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "sql_exporter_http_request_duration_seconds",
+		Help: "Duration of HTTP requests to the exporter, by handler and status code.",
+	}, []string{"handler", "code"})
+
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sql_exporter_http_requests_total",
+		Help: "Total number of HTTP requests to the exporter, by handler and status code.",
+	}, []string{"handler", "code"})
+)
+
+func init() {
+	prometheus.MustRegister(scrapeDuration, scrapeErrors, targetUp, lastScrapeTimestamp,
+		httpRequestDuration, httpRequestsTotal)
+}
+
+// observeScrape wraps a target scrape, recording scrapeDuration,
+// scrapeErrors, targetUp and lastScrapeTimestamp for it, at collector
+// granularity - the finest boundary visible from this package without
+// instrumenting the sql_exporter library's own query execution path, which
+// lives outside this module.
+//
+// A panic is one failure signal, but most real scrape failures - a broken
+// connection, a failing query - are logged and swallowed by Collect rather
+// than panicking, so a scrape is also judged a failure if it panics or
+// writes zero metrics to ch: a Collect call that produced nothing scraped
+// nothing. ch is the real channel the caller's Collect was given; scrape is
+// handed a proxy so metric writes can be counted as they're forwarded.
+func observeScrape(target, collector string, ch chan<- prometheus.Metric, scrape func(chan<- prometheus.Metric)) {
+	start := time.Now()
+
+	proxy := make(chan prometheus.Metric)
+	count := 0
+	forwarded := make(chan struct{})
+	go func() {
+		for m := range proxy {
+			count++
+			ch <- m
+		}
+		close(forwarded)
+	}()
+
+	rec := func() (rec interface{}) {
+		defer func() { rec = recover() }()
+		scrape(proxy)
+		return nil
+	}()
+	close(proxy)
+	<-forwarded
+
+	duration := time.Since(start).Seconds()
+	scrapeDuration.WithLabelValues(target, collector).Observe(duration)
+	lastScrapeTimestamp.WithLabelValues(target).SetToCurrentTime()
+	if rec == nil && count > 0 {
+		targetUp.WithLabelValues(target).Set(1)
+	} else {
+		targetUp.WithLabelValues(target).Set(0)
+		scrapeErrors.WithLabelValues(target, collector).Inc()
+	}
+
+	if rec != nil {
+		panic(rec)
+	}
+}
+
+// targetLabelFor derives a low-cardinality, credential-free label value for
+// a target DSN: the host portion of a URI-style DSN, or the "host=" value of
+// a libpq-style key=value DSN. DSN shapes this package can't parse without
+// reimplementing a driver's own format (e.g. the Go MySQL driver's
+// user:pass@tcp(host:port)/db) fall back to a fixed placeholder.
+func targetLabelFor(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	if m := keyValueDSNHostPattern.FindStringSubmatch(dsn); len(m) == 2 {
+		return m[1]
+	}
+	return "unknown"
+}
+
+var keyValueDSNHostPattern = regexp.MustCompile(`(?:^|\s)host=([^\s']+)`)
+
+// instrumentedExporter wraps the configured Exporter so the real /metrics
+// scrape path records scrapeDuration/scrapeErrors/targetUp/lastScrapeTimestamp
+// - previously these were only ever observed for ad-hoc /probe requests,
+// never for the exporter's primary, configured-target use case.
+type instrumentedExporter struct {
+	sql_exporter.Exporter
+}
+
+func (e instrumentedExporter) Collect(ch chan<- prometheus.Metric) {
+	target := targetLabelFor(string(e.Config().Target.DSN))
+	// The wrapped Exporter scrapes every collector configured for its
+	// target in one pass; it doesn't expose the individual collector names
+	// to this package, so they're reported together under "*".
+	observeScrape(target, "*", ch, func(ch chan<- prometheus.Metric) {
+		e.Exporter.Collect(ch)
+	})
+}
+
+// instrumentHandler wraps a handler with promhttp's standard request
+// duration and status-code counters, labeled by the given handler name. This
+// gives per-request latency and status buckets in addition to the
+// scrape-level detail above - today InstrumentMetricHandler only gave a bare
+// request count. No per-query timings are recorded.
+func instrumentHandler(name string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"handler": name}
+	return promhttp.InstrumentHandlerDuration(
+		httpRequestDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(httpRequestsTotal.MustCurryWith(labels), handler),
+	)
+}
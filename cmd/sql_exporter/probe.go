@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/burningalchemist/sql_exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// probeCollector adapts a single ad-hoc sql_exporter.Target to the
+// prometheus.Collector interface so it can be registered on a per-request
+// registry, mirroring the multi-target pattern used by postgres_exporter.
+// Collect is instrumented with the same scrape_duration/target_up metrics
+// the regular /metrics path records.
+type probeCollector struct {
+	ctx            context.Context
+	target         sql_exporter.Target
+	targetLabel    string
+	collectorNames string
+}
+
+func (p probeCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (p probeCollector) Collect(ch chan<- prometheus.Metric) {
+	observeScrape(p.targetLabel, p.collectorNames, ch, func(ch chan<- prometheus.Metric) {
+		p.target.Collect(p.ctx, ch)
+	})
+}
+
+// ProbeHandlerFor returns a handler for `/probe?target=<dsn>&auth_module=<name>&collector=<name>[,...]`.
+// It builds a fresh Target and Registry per request so concurrent probes for
+// different targets never share state. Config and auth modules are read
+// through reloader so a collector added, or credentials rotated, by a
+// reload are visible to the very next probe request.
+func ProbeHandlerFor(reloader *reloader, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		targetDSN := params.Get("target")
+		if targetDSN == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		collectorNames := splitAndTrim(params.Get("collector"))
+		if len(collectorNames) == 0 {
+			http.Error(w, "collector parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		dsn, err := reloader.AuthModules().Resolve(params.Get("auth_module"), targetDSN)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		config := reloader.Config()
+		collectors, err := config.Collectors.SubsetFor(collectorNames)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unknown collector(s): %v", err), http.StatusBadRequest)
+			return
+		}
+
+		target, err := sql_exporter.NewTarget("", "probe", dsn, collectors, nil, config.Globals)
+		if err != nil {
+			// dsn has auth_module credentials merged into it - never echo
+			// the library's error back to the caller, since DSN-parsing
+			// errors commonly include the offending DSN verbatim.
+			logger.Error("Error creating probe target", "err", err)
+			http.Error(w, "error creating probe target", http.StatusInternalServerError)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(probeCollector{
+			ctx:            r.Context(),
+			target:         target,
+			targetLabel:    targetLabelFor(dsn),
+			collectorNames: strings.Join(collectorNames, ","),
+		})
+
+		logger.Debug("Probing target", "collectors", collectorNames)
+		opts := promhttp.HandlerOpts{ErrorLog: slogPromHTTPLogger{logger: logger}}
+		promhttp.HandlerFor(registry, opts).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/burningalchemist/sql_exporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sql_exporter_config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful.",
+	})
+	configLastReloadSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sql_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(configLastReloadSuccessful, configLastReloadSuccessTimestamp)
+}
+
+// reloader serializes config reloads so that a SIGHUP, a /-/reload request
+// and an fsnotify event can never race each other's swap of the live
+// Exporter, and holds the auth modules alongside it so that rotating
+// auth_modules: credentials doesn't require a process restart.
+//
+// reloader embeds sql_exporter.Exporter so it can be handed directly to
+// ConfigHandlerFunc, ExporterHandlerFor and ProbeHandlerFor: every call
+// they make is promoted straight through to whichever Exporter Reload most
+// recently swapped in, instead of those handlers holding their own,
+// never-updated copy of the pre-reload Exporter.
+type reloader struct {
+	mu sync.Mutex
+	sql_exporter.Exporter
+	configFile  string
+	authModules AuthModules
+	logger      *slog.Logger
+}
+
+func newReloader(configFile string, exporter sql_exporter.Exporter, authModules AuthModules, logger *slog.Logger) *reloader {
+	return &reloader{configFile: configFile, Exporter: exporter, authModules: authModules, logger: logger}
+}
+
+// AuthModules returns the currently active auth modules, safe for
+// concurrent use with Reload.
+func (r *reloader) AuthModules() AuthModules {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.authModules
+}
+
+// Reload parses the config file into a candidate Exporter and re-reads
+// auth_modules, before touching anything live. Only once both succeed does
+// the candidate Exporter - config, collectors and all - replace the one
+// every handler was built around; on any error the previous config is left
+// serving.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	candidate, err := sql_exporter.NewExporter(r.configFile)
+	if err != nil {
+		configLastReloadSuccessful.Set(0)
+		return fmt.Errorf("error validating new config: %w", err)
+	}
+
+	authModules, err := LoadAuthModules(r.configFile)
+	if err != nil {
+		configLastReloadSuccessful.Set(0)
+		return fmt.Errorf("error reloading auth modules: %w", err)
+	}
+
+	r.Exporter = candidate
+	r.authModules = authModules
+
+	configLastReloadSuccessful.Set(1)
+	configLastReloadSuccessTimestamp.SetToCurrentTime()
+	return nil
+}
+
+// ReloadHandlerFor returns the `/-/reload` handler, matching the convention
+// used by Prometheus and its exporters for triggering a config reload over
+// HTTP. Only POST and PUT are accepted - unlike GET, neither can be
+// triggered by a browser navigation, a link prefetch or a naive health
+// check, so a reload only ever happens on purpose.
+func ReloadHandlerFor(r *reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost && req.Method != http.MethodPut {
+			http.Error(w, "only POST and PUT are supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.Reload(); err != nil {
+			r.logger.Error("Error reloading config", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}